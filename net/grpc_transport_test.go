@@ -0,0 +1,109 @@
+/*
+Copyright 2017 Mosaic Networks Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package net
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func newTestGRPCTransport(t *testing.T, dialOpts []grpc.DialOption) *GRPCTransport {
+	t.Helper()
+	trans, err := NewGRPCTransport("127.0.0.1:0", dialOpts, nil, time.Second, testLogger())
+	if err != nil {
+		t.Fatalf("failed to start GRPCTransport: %v", err)
+	}
+	return trans
+}
+
+func TestGRPCTransportSyncRoundTrip(t *testing.T) {
+	server := newTestGRPCTransport(t, nil)
+	defer server.Close()
+
+	client := newTestGRPCTransport(t, []grpc.DialOption{grpc.WithInsecure()})
+	defer client.Close()
+
+	go func() {
+		rpc := <-server.Consumer()
+		req := rpc.Command.(*SyncRequest)
+		rpc.RespChan <- RPCResponse{
+			Response: &SyncResponse{FromID: req.FromID + "-pong"},
+		}
+	}()
+
+	args := &SyncRequest{FromID: "ping"}
+	resp := &SyncResponse{}
+	if err := client.Sync(server.LocalAddr(), args, resp); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if resp.FromID != "ping-pong" {
+		t.Fatalf("resp.FromID = %q, want %q", resp.FromID, "ping-pong")
+	}
+}
+
+func TestGRPCTransportSyncPropagatesApplicationError(t *testing.T) {
+	server := newTestGRPCTransport(t, nil)
+	defer server.Close()
+
+	client := newTestGRPCTransport(t, []grpc.DialOption{grpc.WithInsecure()})
+	defer client.Close()
+
+	go func() {
+		rpc := <-server.Consumer()
+		rpc.RespChan <- RPCResponse{Error: errors.New("remote handler failed")}
+	}()
+
+	err := client.Sync(server.LocalAddr(), &SyncRequest{FromID: "ping"}, &SyncResponse{})
+	if err == nil {
+		t.Fatal("Sync returned nil error, want the remote handler's error surfaced")
+	}
+	if err.Error() != "remote handler failed" {
+		t.Fatalf("Sync error = %q, want %q", err.Error(), "remote handler failed")
+	}
+}
+
+func TestGRPCTransportCachesClientConn(t *testing.T) {
+	server := newTestGRPCTransport(t, nil)
+	defer server.Close()
+
+	client := newTestGRPCTransport(t, []grpc.DialOption{grpc.WithInsecure()})
+	defer client.Close()
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			rpc := <-server.Consumer()
+			req := rpc.Command.(*SyncRequest)
+			rpc.RespChan <- RPCResponse{Response: &SyncResponse{FromID: req.FromID}}
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := client.Sync(server.LocalAddr(), &SyncRequest{FromID: "ping"}, &SyncResponse{}); err != nil {
+			t.Fatalf("Sync returned error: %v", err)
+		}
+	}
+
+	client.connsLock.Lock()
+	numConns := len(client.conns)
+	client.connsLock.Unlock()
+
+	if numConns != 1 {
+		t.Fatalf("client cached %d ClientConns for one target after 2 Sync calls, want 1", numConns)
+	}
+}
@@ -17,22 +17,33 @@ package net
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
+	"os"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/yamux"
 )
 
 const (
 	rpcSync uint8 = iota
+	rpcFastForward
 
 	// DefaultTimeoutScale is the default TimeoutScale in a NetworkTransport.
 	DefaultTimeoutScale = 256 * 1024 // 256KB
+
+	// fastForwardChunkSize is the size of each length-prefixed chunk that
+	// FastForward streams from server to client.
+	fastForwardChunkSize = 16 * 1024
 )
 
 var (
@@ -57,6 +68,12 @@ by the gob encoded request.
 
 The response is an error string followed by the response object,
 both are encoded using gob.
+
+When EnableMultiplexing is set, connections to a peer are not opened
+one per in-flight RPC. Instead a single yamux session is dialled per
+peer and each RPC gets its own logical stream on that session, so many
+concurrent Sync RPCs to the same peer share one TCP connection instead
+of serializing on a pool of dedicated conns.
 */
 type NetworkTransport struct {
 	connPool     map[string][]*netConn
@@ -75,6 +92,50 @@ type NetworkTransport struct {
 	stream StreamLayer
 
 	timeout time.Duration
+
+	enableMultiplexing bool
+	muxSessions        map[string]*yamux.Session
+	muxSessionsLock    sync.Mutex
+	muxDialLocks       map[string]*sync.Mutex
+	muxDialLocksLock   sync.Mutex
+
+	retry RetryConfig
+}
+
+// RetryConfig controls how genericRPC retries a Sync RPC that failed with
+// a transient error (a dial failure, an i/o timeout, or an EOF reading a
+// pooled connection that the peer silently closed). Each retry waits
+// min(Cap, Base*2^attempt) with full jitter in [0, d) before re-dialing,
+// up to MaxRetries retries after the first attempt. The zero value disables retries, preserving
+// the previous fail-fast behavior.
+type RetryConfig struct {
+	Base       time.Duration
+	Cap        time.Duration
+	MaxRetries int
+}
+
+// NetworkTransportConfig encapsulates configuration for NewNetworkTransportWithConfig.
+type NetworkTransportConfig struct {
+	// Stream is used to provide the low level stream abstraction.
+	Stream StreamLayer
+
+	// MaxPool controls how many connections we will pool.
+	MaxPool int
+
+	// Timeout is used to apply I/O deadlines.
+	Timeout time.Duration
+
+	// Logger is used to emit log messages.
+	Logger *logrus.Logger
+
+	// EnableMultiplexing opens a single yamux session per peer and
+	// multiplexes every RPC onto its own logical stream over that
+	// session, instead of pooling one TCP connection per in-flight RPC.
+	EnableMultiplexing bool
+
+	// Retry configures backoff for transient Sync RPC failures. The zero
+	// value disables retries.
+	Retry RetryConfig
 }
 
 // StreamLayer is used with the NetworkTransport to provide
@@ -108,18 +169,35 @@ func NewNetworkTransport(
 	timeout time.Duration,
 	logger *logrus.Logger,
 ) *NetworkTransport {
+	return NewNetworkTransportWithConfig(&NetworkTransportConfig{
+		Stream:  stream,
+		MaxPool: maxPool,
+		Timeout: timeout,
+		Logger:  logger,
+	})
+}
+
+// NewNetworkTransportWithConfig creates a new network transport from the
+// given config, giving callers access to options (such as
+// EnableMultiplexing) that don't fit in NewNetworkTransport's argument list.
+func NewNetworkTransportWithConfig(config *NetworkTransportConfig) *NetworkTransport {
+	logger := config.Logger
 	if logger == nil {
 		logger = logrus.New()
 		logger.Level = logrus.DebugLevel
 	}
 	trans := &NetworkTransport{
-		connPool:   make(map[string][]*netConn),
-		consumeCh:  make(chan RPC),
-		logger:     logger,
-		maxPool:    maxPool,
-		shutdownCh: make(chan struct{}),
-		stream:     stream,
-		timeout:    timeout,
+		connPool:           make(map[string][]*netConn),
+		consumeCh:          make(chan RPC),
+		logger:             logger,
+		maxPool:            config.MaxPool,
+		shutdownCh:         make(chan struct{}),
+		stream:             config.Stream,
+		timeout:            config.Timeout,
+		enableMultiplexing: config.EnableMultiplexing,
+		muxSessions:        make(map[string]*yamux.Session),
+		muxDialLocks:       make(map[string]*sync.Mutex),
+		retry:              config.Retry,
 	}
 	go trans.listen()
 	return trans
@@ -133,6 +211,14 @@ func (n *NetworkTransport) Close() error {
 	if !n.shutdown {
 		close(n.shutdownCh)
 		n.stream.Close()
+
+		n.muxSessionsLock.Lock()
+		for target, sess := range n.muxSessions {
+			sess.Close()
+			delete(n.muxSessions, target)
+		}
+		n.muxSessionsLock.Unlock()
+
 		n.shutdown = true
 	}
 	return nil
@@ -182,6 +268,10 @@ func (n *NetworkTransport) getConn(target string, timeout time.Duration) (*netCo
 		return conn, nil
 	}
 
+	if n.enableMultiplexing {
+		return n.getMuxConn(target, timeout)
+	}
+
 	// Dial a new connection
 	conn, err := n.stream.Dial(target, timeout)
 	if err != nil {
@@ -203,6 +293,116 @@ func (n *NetworkTransport) getConn(target string, timeout time.Duration) (*netCo
 	return netConn, nil
 }
 
+// getMuxConn opens a fresh logical stream on the per-peer yamux session,
+// dialing and establishing the session first if none exists yet.
+func (n *NetworkTransport) getMuxConn(target string, timeout time.Duration) (*netConn, error) {
+	sess, err := n.getMuxSession(target, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := sess.Open()
+	if err != nil {
+		// The session may have died (e.g. the peer went away). Drop it
+		// and retry once against a freshly dialed session.
+		n.dropMuxSession(target, sess)
+		sess, err = n.getMuxSession(target, timeout)
+		if err != nil {
+			return nil, err
+		}
+		stream, err = sess.Open()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	netConn := &netConn{
+		target: target,
+		conn:   stream,
+		r:      bufio.NewReader(stream),
+		w:      bufio.NewWriter(stream),
+	}
+	netConn.dec = gob.NewDecoder(netConn.r)
+	netConn.enc = gob.NewEncoder(netConn.w)
+
+	return netConn, nil
+}
+
+// getMuxSession returns the cached yamux session for target, dialing and
+// establishing a new one if there isn't a live one already. Only the
+// brief map lookups go through the shared muxSessionsLock; the dial
+// itself is serialized per-target via muxDialLock, so establishing a
+// session to one flapping peer doesn't block getMuxConn calls for every
+// other peer.
+func (n *NetworkTransport) getMuxSession(target string, timeout time.Duration) (*yamux.Session, error) {
+	if sess, ok := n.cachedMuxSession(target); ok {
+		return sess, nil
+	}
+
+	dialLock := n.muxDialLock(target)
+	dialLock.Lock()
+	defer dialLock.Unlock()
+
+	// Another goroutine may have established the session for target
+	// while we were waiting on dialLock.
+	if sess, ok := n.cachedMuxSession(target); ok {
+		return sess, nil
+	}
+
+	conn, err := n.stream.Dial(target, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := yamux.Client(conn, yamux.DefaultConfig())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	n.muxSessionsLock.Lock()
+	n.muxSessions[target] = sess
+	n.muxSessionsLock.Unlock()
+
+	return sess, nil
+}
+
+// cachedMuxSession returns the live session cached for target, if any.
+func (n *NetworkTransport) cachedMuxSession(target string) (*yamux.Session, bool) {
+	n.muxSessionsLock.Lock()
+	defer n.muxSessionsLock.Unlock()
+
+	sess, ok := n.muxSessions[target]
+	if !ok || sess.IsClosed() {
+		return nil, false
+	}
+	return sess, true
+}
+
+// muxDialLock returns the per-target mutex used to serialize dials to
+// target, creating it if this is the first call for that target.
+func (n *NetworkTransport) muxDialLock(target string) *sync.Mutex {
+	n.muxDialLocksLock.Lock()
+	defer n.muxDialLocksLock.Unlock()
+
+	lock, ok := n.muxDialLocks[target]
+	if !ok {
+		lock = &sync.Mutex{}
+		n.muxDialLocks[target] = lock
+	}
+	return lock
+}
+
+// dropMuxSession removes a dead session from the cache and closes it.
+func (n *NetworkTransport) dropMuxSession(target string, sess *yamux.Session) {
+	n.muxSessionsLock.Lock()
+	if cur, ok := n.muxSessions[target]; ok && cur == sess {
+		delete(n.muxSessions, target)
+	}
+	n.muxSessionsLock.Unlock()
+	sess.Close()
+}
+
 // returnConn returns a connection back to the pool.
 func (n *NetworkTransport) returnConn(conn *netConn) {
 	n.connPoolLock.Lock()
@@ -223,13 +423,187 @@ func (n *NetworkTransport) Sync(target string, args *SyncRequest, resp *SyncResp
 	return n.genericRPC(target, rpcSync, args, resp)
 }
 
-// genericRPC handles a simple request/response RPC.
+// FastForwardRequest is the payload of an rpcFastForward RPC, identifying
+// what the requesting node already knows so the peer can decide what to
+// stream back.
+type FastForwardRequest struct {
+	FromID string
+}
+
+// FastForwardResponse is the RPC-level response to an rpcFastForward
+// request. Reader is streamed to the client's io.Writer chunk by chunk
+// instead of being gob-encoded whole, so the application can hand over a
+// hashgraph frame plus block signatures plus a snapshot without holding
+// the entire thing in memory as a single gob-encodable value.
+type FastForwardResponse struct {
+	Reader io.Reader
+}
+
+// FastForward implements a streaming RPC that lets a lagging or fresh
+// node catch up on a hashgraph frame, block signatures and application
+// snapshot without gob-encoding the whole (potentially multi-megabyte)
+// payload in one shot. The bytes read from the peer are copied to w as
+// they arrive.
+func (n *NetworkTransport) FastForward(target string, req *FastForwardRequest, w io.Writer) error {
+	conn, err := n.getConn(target, n.timeout)
+	if err != nil {
+		n.logger.Debugf("failed to acquire connection to %s after %d: %v", target, n.timeout, err)
+		return err
+	}
+
+	if n.timeout > 0 {
+		conn.conn.SetDeadline(time.Now().Add(n.timeout))
+	}
+
+	if err := sendRPC(conn, rpcFastForward, req, n.logger); err != nil {
+		n.logger.Debugf("error sending RPC: %v", err)
+		return err
+	}
+
+	// The error string is still gob-encoded, exactly like a plain Sync
+	// response; only the payload that follows switches to length-prefixed
+	// raw chunks.
+	var rpcError string
+	if err := conn.dec.Decode(&rpcError); err != nil {
+		conn.Release()
+		return err
+	}
+	if rpcError != "" {
+		conn.Release()
+		return fmt.Errorf(rpcError)
+	}
+
+	if err := readChunks(conn, w, n.timeout); err != nil {
+		conn.Release()
+		return err
+	}
+
+	n.returnConn(conn)
+	return nil
+}
+
+// readChunks reads a sequence of length-prefixed chunks off conn, copying
+// each one to w, until it hits the zero-length chunk that terminates the
+// stream. Unlike a plain Sync RPC, the total size of a FastForward stream
+// isn't known up front, so timeout (tuned for small control-plane RPCs)
+// can't be applied once for the whole transfer without starving large
+// snapshots. Instead the deadline is refreshed before every chunk, scaled
+// by fastForwardChunkSize relative to DefaultTimeoutScale, so the budget
+// is per-chunk rather than for the whole, potentially multi-megabyte,
+// stream.
+func readChunks(conn *netConn, w io.Writer, timeout time.Duration) error {
+	chunkTimeout := fastForwardChunkTimeout(timeout)
+
+	for {
+		if chunkTimeout > 0 {
+			conn.conn.SetReadDeadline(time.Now().Add(chunkTimeout))
+		}
+
+		var length uint32
+		if err := binary.Read(conn.r, binary.BigEndian, &length); err != nil {
+			return err
+		}
+		if length == 0 {
+			return nil
+		}
+
+		if chunkTimeout > 0 {
+			conn.conn.SetReadDeadline(time.Now().Add(chunkTimeout))
+		}
+		if _, err := io.CopyN(w, conn.r, int64(length)); err != nil {
+			return err
+		}
+	}
+}
+
+// fastForwardChunkTimeout scales timeout (sized for a whole RPC of about
+// DefaultTimeoutScale bytes) down to a per-chunk budget proportional to
+// fastForwardChunkSize, since one chunk is far smaller than the payload
+// timeout was tuned for and reading it should fail fast rather than
+// waiting out the full RPC timeout. It falls back to timeout itself if
+// the scaled value underflows to zero, e.g. because timeout is very
+// small to begin with.
+func fastForwardChunkTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return 0
+	}
+	scaled := timeout * time.Duration(fastForwardChunkSize) / time.Duration(DefaultTimeoutScale)
+	if scaled <= 0 {
+		return timeout
+	}
+	return scaled
+}
+
+// writeChunks reads from r in fastForwardChunkSize pieces and writes each
+// one to w as a length-prefixed chunk, finishing with a zero-length chunk
+// to signal the end of the stream.
+func writeChunks(w *bufio.Writer, r io.Reader) error {
+	buf := make([]byte, fastForwardChunkSize)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			if err := binary.Write(w, binary.BigEndian, uint32(n)); err != nil {
+				return err
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	return binary.Write(w, binary.BigEndian, uint32(0))
+}
+
+// genericRPC handles a simple request/response RPC, retrying transient
+// failures with exponential backoff and full jitter per n.retry.
 func (n *NetworkTransport) genericRPC(target string, rpcType uint8, args interface{}, resp interface{}) error {
+	var lastErr error
+
+	for attempt := 0; ; attempt++ {
+		err := n.tryGenericRPC(target, rpcType, args, resp)
+		if err == nil {
+			return nil
+		}
+
+		transient, permErr := unwrapTransient(err)
+		if !transient {
+			return permErr
+		}
+		lastErr = permErr
+
+		if attempt >= n.retry.MaxRetries {
+			return lastErr
+		}
+
+		delay := backoffWithJitter(n.retry.Base, n.retry.Cap, attempt)
+		n.logger.Debugf("transient error on RPC to %s (attempt %d/%d): %v; retrying in %s",
+			target, attempt+1, n.retry.MaxRetries, lastErr, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-n.shutdownCh:
+			return lastErr
+		}
+	}
+}
+
+// tryGenericRPC performs a single attempt of a simple request/response
+// RPC. Errors are wrapped in transientErr when they stem from a dead
+// connection (dial failure, write failure, or an EOF/timeout decoding the
+// response) so genericRPC knows to retry them; a decode error or an
+// application-level rpcError string comes back unwrapped, since those are
+// permanent.
+func (n *NetworkTransport) tryGenericRPC(target string, rpcType uint8, args interface{}, resp interface{}) error {
 	// Get a conn
 	conn, err := n.getConn(target, n.timeout)
 	if err != nil {
 		n.logger.Debugf("failed to acquire connection to %s after %d: %v", target, n.timeout, err)
-		return err
+		return transientErr{err}
 	}
 
 	// Set a deadline
@@ -241,7 +615,7 @@ func (n *NetworkTransport) genericRPC(target string, rpcType uint8, args interfa
 	// Send the RPC
 	if err = sendRPC(conn, rpcType, args, n.logger); err != nil {
 		n.logger.Debugf("error sending RPC: %v", err)
-		return err
+		return transientErr{err}
 	}
 
 	// Decode the response
@@ -250,13 +624,89 @@ func (n *NetworkTransport) genericRPC(target string, rpcType uint8, args interfa
 	if canReturn {
 		n.logger.Debug("returning reusable connection to pool")
 		n.returnConn(conn)
+		// err here, if any, is the application-level rpcError string:
+		// always permanent.
+		return err
 	}
-	if err != nil {
-		n.logger.Debugf("error decoding response: %v", err)
+
+	n.logger.Debugf("error decoding response: %v", err)
+	if isTransientIOErr(err) {
+		return transientErr{err}
 	}
 	return err
 }
 
+// transientErr marks an error as safe to retry.
+type transientErr struct{ err error }
+
+func (t transientErr) Error() string { return t.err.Error() }
+func (t transientErr) Unwrap() error { return t.err }
+
+// unwrapTransient reports whether err is a transientErr, and returns the
+// underlying error to surface to the caller either way.
+func unwrapTransient(err error) (transient bool, underlying error) {
+	if t, ok := err.(transientErr); ok {
+		return true, t.err
+	}
+	return false, err
+}
+
+// isTimeout reports whether err is a network timeout, e.g. one raised by
+// the connection deadline set above.
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// isTransientIOErr reports whether err is the kind of I/O failure expected
+// from a pooled connection that was silently reaped out from under us —
+// the peer closing cleanly mid-read (io.EOF), closing mid-frame
+// (io.ErrUnexpectedEOF), resetting the connection or closing our write end
+// (ECONNRESET/EPIPE), or a deadline tripping — as opposed to a permanent,
+// application-level failure. Safe to retry.
+func isTransientIOErr(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if isTimeout(err) {
+		return true
+	}
+	return isConnReset(err)
+}
+
+// isConnReset reports whether err wraps ECONNRESET or EPIPE, the errnos a
+// reaped pooled connection typically surfaces as on its next use.
+func isConnReset(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	sysErr, ok := opErr.Err.(*os.SyscallError)
+	if !ok {
+		return false
+	}
+	return sysErr.Err == syscall.ECONNRESET || sysErr.Err == syscall.EPIPE
+}
+
+// backoffWithJitter computes min(cap, base*2^attempt), then returns a
+// random duration in [0, d) (full jitter), to avoid a thundering herd of
+// reconnects when a peer flaps.
+func backoffWithJitter(base, cap time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+
+	d := base * time.Duration(uint64(1)<<uint(attempt))
+	if cap > 0 && (d > cap || d <= 0) {
+		d = cap
+	}
+	if d <= 0 {
+		d = base
+	}
+
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
 // listen is used to handling incoming connections.
 func (n *NetworkTransport) listen() {
 	for {
@@ -275,7 +725,34 @@ func (n *NetworkTransport) listen() {
 		}).Debug("accepted connection")
 
 		// Handle the connection in dedicated routine
-		go n.handleConn(conn)
+		if n.enableMultiplexing {
+			go n.handleMuxSession(conn)
+		} else {
+			go n.handleConn(conn)
+		}
+	}
+}
+
+// handleMuxSession wraps an accepted conn as a yamux server session and
+// hands each logical stream the peer opens off to handleConn, just as if
+// it were its own plain connection.
+func (n *NetworkTransport) handleMuxSession(conn net.Conn) {
+	sess, err := yamux.Server(conn, yamux.DefaultConfig())
+	if err != nil {
+		n.logger.WithField("error", err).Error("Failed to establish multiplexed session")
+		conn.Close()
+		return
+	}
+
+	for {
+		stream, err := sess.Accept()
+		if err != nil {
+			if err != io.EOF && !n.IsShutdown() {
+				n.logger.WithField("error", err).Debug("multiplexed session closed")
+			}
+			return
+		}
+		go n.handleConn(stream)
 	}
 }
 
@@ -288,7 +765,7 @@ func (n *NetworkTransport) handleConn(conn net.Conn) {
 	enc := gob.NewEncoder(w)
 
 	for {
-		if err := n.handleCommand(r, dec, enc); err != nil {
+		if err := n.handleCommand(r, w, dec, enc); err != nil {
 			if err != io.EOF {
 				n.logger.WithField("error", err).Error("Failed to decode incoming command")
 			}
@@ -302,7 +779,7 @@ func (n *NetworkTransport) handleConn(conn net.Conn) {
 }
 
 // handleCommand is used to decode and dispatch a single command.
-func (n *NetworkTransport) handleCommand(r *bufio.Reader, dec *gob.Decoder, enc *gob.Encoder) error {
+func (n *NetworkTransport) handleCommand(r *bufio.Reader, w *bufio.Writer, dec *gob.Decoder, enc *gob.Encoder) error {
 	// Get the rpc type
 	rpcType, err := r.ReadByte()
 	if err != nil {
@@ -324,6 +801,13 @@ func (n *NetworkTransport) handleCommand(r *bufio.Reader, dec *gob.Decoder, enc
 		}
 		rpc.Command = &req
 
+	case rpcFastForward:
+		var req FastForwardRequest
+		if err := dec.Decode(&req); err != nil {
+			return err
+		}
+		rpc.Command = &req
+
 	default:
 		return fmt.Errorf("unknown rpc type %d", rpcType)
 	}
@@ -347,6 +831,20 @@ func (n *NetworkTransport) handleCommand(r *bufio.Reader, dec *gob.Decoder, enc
 			return err
 		}
 
+		if rpcType == rpcFastForward {
+			// The response carries a raw io.Reader rather than a
+			// gob-encodable value; stream it as length-prefixed chunks
+			// instead of encoding it whole.
+			var reader io.Reader
+			if ffResp, ok := resp.Response.(*FastForwardResponse); ok && ffResp != nil {
+				reader = ffResp.Reader
+			}
+			if reader == nil {
+				reader = bytes.NewReader(nil)
+			}
+			return writeChunks(w, reader)
+		}
+
 		// Send the response
 		if err := enc.Encode(resp.Response); err != nil {
 			return err
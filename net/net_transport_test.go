@@ -0,0 +1,234 @@
+/*
+Copyright 2017 Mosaic Networks Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// testLogger returns a *logrus.Logger that discards its output, so test
+// runs aren't spammed with the package's normal Debug-level logging.
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
+
+func TestFastForwardChunkTimeout(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{0, 0},
+		{10 * time.Second, 10 * time.Second * fastForwardChunkSize / DefaultTimeoutScale},
+		{time.Minute, time.Minute * fastForwardChunkSize / DefaultTimeoutScale},
+		// Small enough that the scaled value underflows to zero; falls
+		// back to timeout itself rather than handing out a deadline
+		// that's already expired.
+		{1, 1},
+	}
+
+	for _, tt := range tests {
+		if got := fastForwardChunkTimeout(tt.timeout); got != tt.want {
+			t.Errorf("fastForwardChunkTimeout(%s) = %s, want %s", tt.timeout, got, tt.want)
+		}
+	}
+
+	if got := fastForwardChunkTimeout(10 * time.Second); got >= 10*time.Second {
+		t.Errorf("fastForwardChunkTimeout(10s) = %s, want a smaller per-chunk budget", got)
+	}
+}
+
+func TestBackoffWithJitterBounds(t *testing.T) {
+	base := 10 * time.Millisecond
+	cap := 100 * time.Millisecond
+
+	for attempt := 0; attempt < 10; attempt++ {
+		for i := 0; i < 20; i++ {
+			d := backoffWithJitter(base, cap, attempt)
+			if d < 0 {
+				t.Fatalf("attempt %d: backoffWithJitter returned negative duration %s", attempt, d)
+			}
+			if d > cap {
+				t.Fatalf("attempt %d: backoffWithJitter returned %s, want <= cap %s", attempt, d, cap)
+			}
+		}
+	}
+}
+
+func TestBackoffWithJitterZeroBase(t *testing.T) {
+	// base <= 0 falls back to the 500ms default rather than jittering
+	// around zero forever.
+	d := backoffWithJitter(0, 0, 0)
+	if d < 0 || d > 500*time.Millisecond {
+		t.Fatalf("backoffWithJitter(0, 0, 0) = %s, want in [0, 500ms]", d)
+	}
+}
+
+func TestIsTransientIOErr(t *testing.T) {
+	permanent := errors.New("application-level failure")
+	connReset := &net.OpError{
+		Op:  "read",
+		Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET},
+	}
+	brokenPipe := &net.OpError{
+		Op:  "write",
+		Err: &os.SyscallError{Syscall: "write", Err: syscall.EPIPE},
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"EOF", io.EOF, true},
+		{"UnexpectedEOF", io.ErrUnexpectedEOF, true},
+		{"ConnReset", connReset, true},
+		{"BrokenPipe", brokenPipe, true},
+		{"Permanent", permanent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientIOErr(tt.err); got != tt.want {
+				t.Errorf("isTransientIOErr(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteReadChunksRoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// Several chunks' worth, so the framing is exercised more than once.
+	payload := bytes.Repeat([]byte("babble"), fastForwardChunkSize/2)
+
+	writeErrCh := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriter(client)
+		if err := writeChunks(w, bytes.NewReader(payload)); err != nil {
+			writeErrCh <- err
+			return
+		}
+		writeErrCh <- w.Flush()
+	}()
+
+	conn := &netConn{
+		conn: server,
+		r:    bufio.NewReader(server),
+	}
+
+	var got bytes.Buffer
+	if err := readChunks(conn, &got, 0); err != nil {
+		t.Fatalf("readChunks returned error: %v", err)
+	}
+
+	if err := <-writeErrCh; err != nil {
+		t.Fatalf("writeChunks returned error: %v", err)
+	}
+
+	if !bytes.Equal(got.Bytes(), payload) {
+		t.Fatalf("round-tripped payload mismatch: got %d bytes, want %d bytes", got.Len(), len(payload))
+	}
+}
+
+// countingStreamLayer wraps a TCPStreamLayer and counts outgoing Dial
+// calls, so tests can assert how many times a target was actually dialed.
+type countingStreamLayer struct {
+	*TCPStreamLayer
+	dials int32
+}
+
+func (c *countingStreamLayer) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	atomic.AddInt32(&c.dials, 1)
+	return c.TCPStreamLayer.Dial(address, timeout)
+}
+
+// TestGetMuxSessionConcurrentDialSingleFlight guards against regressing
+// d731d9a: many goroutines racing to establish a mux session to the same
+// target must result in exactly one dial, not one per goroutine.
+func TestGetMuxSessionConcurrentDialSingleFlight(t *testing.T) {
+	peerLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start fake peer listener: %v", err)
+	}
+	defer peerLn.Close()
+
+	go func() {
+		for {
+			conn, err := peerLn.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, conn)
+		}
+	}()
+
+	stream, err := NewTCPStreamLayer("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("failed to start stream layer: %v", err)
+	}
+	counting := &countingStreamLayer{TCPStreamLayer: stream}
+
+	trans := NewNetworkTransportWithConfig(&NetworkTransportConfig{
+		Stream:             counting,
+		Timeout:            time.Second,
+		Logger:             testLogger(),
+		EnableMultiplexing: true,
+	})
+	defer trans.Close()
+
+	target := peerLn.Addr().String()
+
+	const concurrency = 20
+	var wg sync.WaitGroup
+	errCh := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := trans.getMuxSession(target, time.Second)
+			errCh <- err
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		if err != nil {
+			t.Fatalf("getMuxSession returned error: %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&counting.dials); got != 1 {
+		t.Fatalf("target was dialed %d times concurrently, want exactly 1 (dial should be serialized per-target, not one per caller)", got)
+	}
+}
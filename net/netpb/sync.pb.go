@@ -0,0 +1,169 @@
+// Package netpb holds the generated-style stubs for sync.proto.
+//
+// This file is hand-maintained, not actual protoc-gen-go output: this
+// checkout has no protoc/protoc-gen-go step wired into its build, so
+// there's nothing to regenerate it from. It mirrors the shape a real
+// protoc-gen-go run against sync.proto would produce (the same message
+// structs, the same NetworkRPCClient/NetworkRPCServer interfaces), but
+// omits the raw file-descriptor bytes and proto.RegisterFile/
+// SupportPackageIsVersion plumbing real codegen emits, since those would
+// be fabricated rather than generated. Keep it in sync with sync.proto
+// by hand until a real protoc step exists; do not reintroduce a "DO NOT
+// EDIT" banner while that's true.
+// source: sync.proto
+
+package netpb
+
+import (
+	context "context"
+	fmt "fmt"
+
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+
+// SyncRequest is the wire representation of net.SyncRequest.
+type SyncRequest struct {
+	FromId string `protobuf:"bytes,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`
+	Known  []byte `protobuf:"bytes,2,opt,name=known,proto3" json:"known,omitempty"`
+}
+
+func (m *SyncRequest) Reset()         { *m = SyncRequest{} }
+func (m *SyncRequest) String() string { return proto.CompactTextString(m) }
+func (*SyncRequest) ProtoMessage()    {}
+
+func (m *SyncRequest) GetFromId() string {
+	if m != nil {
+		return m.FromId
+	}
+	return ""
+}
+
+func (m *SyncRequest) GetKnown() []byte {
+	if m != nil {
+		return m.Known
+	}
+	return nil
+}
+
+// SyncResponse is the wire representation of net.SyncResponse.
+type SyncResponse struct {
+	FromId  string `protobuf:"bytes,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`
+	Success bool   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Error   string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	Events  []byte `protobuf:"bytes,4,opt,name=events,proto3" json:"events,omitempty"`
+	Known   []byte `protobuf:"bytes,5,opt,name=known,proto3" json:"known,omitempty"`
+}
+
+func (m *SyncResponse) Reset()         { *m = SyncResponse{} }
+func (m *SyncResponse) String() string { return proto.CompactTextString(m) }
+func (*SyncResponse) ProtoMessage()    {}
+
+func (m *SyncResponse) GetFromId() string {
+	if m != nil {
+		return m.FromId
+	}
+	return ""
+}
+
+func (m *SyncResponse) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *SyncResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *SyncResponse) GetEvents() []byte {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+func (m *SyncResponse) GetKnown() []byte {
+	if m != nil {
+		return m.Known
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*SyncRequest)(nil), "netpb.SyncRequest")
+	proto.RegisterType((*SyncResponse)(nil), "netpb.SyncResponse")
+}
+
+// NetworkRPCClient is the client API for NetworkRPC service.
+type NetworkRPCClient interface {
+	Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error)
+}
+
+type networkRPCClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewNetworkRPCClient creates a client stub for the NetworkRPC service.
+func NewNetworkRPCClient(cc *grpc.ClientConn) NetworkRPCClient {
+	return &networkRPCClient{cc}
+}
+
+func (c *networkRPCClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error) {
+	out := new(SyncResponse)
+	err := c.cc.Invoke(ctx, "/netpb.NetworkRPC/Sync", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// NetworkRPCServer is the server API for NetworkRPC service.
+type NetworkRPCServer interface {
+	Sync(context.Context, *SyncRequest) (*SyncResponse, error)
+}
+
+func _NetworkRPC_Sync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NetworkRPCServer).Sync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netpb.NetworkRPC/Sync",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NetworkRPCServer).Sync(ctx, req.(*SyncRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RegisterNetworkRPCServer registers the implementation srv to serve the
+// NetworkRPC service on s.
+func RegisterNetworkRPCServer(s *grpc.Server, srv NetworkRPCServer) {
+	s.RegisterService(&_NetworkRPC_serviceDesc, srv)
+}
+
+var _NetworkRPC_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "netpb.NetworkRPC",
+	HandlerType: (*NetworkRPCServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Sync",
+			Handler:    _NetworkRPC_Sync_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "sync.proto",
+}
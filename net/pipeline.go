@@ -0,0 +1,238 @@
+/*
+Copyright 2017 Mosaic Networks Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package net
+
+import (
+	"sync"
+	"time"
+)
+
+// rpcMaxPipeline limits how many Sync RPCs may be in flight on a single
+// pipelined connection at once, bounding memory use if the consumer falls
+// behind draining Consumer().
+const rpcMaxPipeline = 128
+
+// SyncPipeline is used for pipelining Sync RPCs to an aribtrary peer. It
+// allows the caller to send many Sync requests to the same target while
+// hiding the latency of the round trip, rather than blocking on each one
+// in turn.
+type SyncPipeline interface {
+	// Enqueue adds a new Sync request to the pipeline. The future returned
+	// is updated once a response is received.
+	Enqueue(args *SyncRequest, resp *SyncResponse) (SyncFuture, error)
+
+	// Consumer returns a channel that can be used to consume futures as
+	// they are ready, in the order they were enqueued.
+	Consumer() <-chan SyncFuture
+
+	// Close closes the pipeline and cancels any outstanding futures.
+	Close() error
+}
+
+// SyncFuture is used to return information about a pipelined Sync request.
+type SyncFuture interface {
+	// Error blocks until the future arrives and then returns the error
+	// status of the Sync RPC.
+	Error() error
+
+	// Start returns the time that the Sync request was enqueued.
+	Start() time.Time
+
+	// Request holds the parameters of the Sync RPC.
+	Request() *SyncRequest
+
+	// Response holds the result of the Sync RPC, valid after Error
+	// returns.
+	Response() *SyncResponse
+}
+
+// deferError is used to allow a future to be blocked on until it is
+// responded to, mirroring the errCh pattern used throughout babble.
+type deferError struct {
+	err       error
+	errCh     chan error
+	responded bool
+}
+
+func (d *deferError) init() {
+	d.errCh = make(chan error, 1)
+}
+
+func (d *deferError) Error() error {
+	if d.err != nil {
+		// Already responded, don't wait
+		return d.err
+	}
+	if d.errCh == nil {
+		panic("waiting for response on nil channel")
+	}
+	d.err = <-d.errCh
+	return d.err
+}
+
+func (d *deferError) respond(err error) {
+	if d.errCh == nil {
+		return
+	}
+	d.errCh <- err
+	close(d.errCh)
+	d.responded = true
+}
+
+// syncFuture is used to track an async Sync RPC through a pipeline.
+type syncFuture struct {
+	deferError
+
+	start time.Time
+	args  *SyncRequest
+	resp  *SyncResponse
+}
+
+func (s *syncFuture) Start() time.Time {
+	return s.start
+}
+
+func (s *syncFuture) Request() *SyncRequest {
+	return s.args
+}
+
+func (s *syncFuture) Response() *SyncResponse {
+	return s.resp
+}
+
+// netPipeline implements SyncPipeline over a single netConn. The conn is
+// owned exclusively by the pipeline: Enqueue writes each request from the
+// caller's goroutine, serialized by shutdownLock, and a background
+// goroutine drains dec.Decode responses in the
+// order they arrive, which is always FIFO per connection, so no
+// correlation ID is needed to match a response back to its future.
+type netPipeline struct {
+	conn  *netConn
+	trans *NetworkTransport
+
+	doneCh       chan SyncFuture
+	inprogressCh chan *syncFuture
+
+	shutdown     bool
+	shutdownCh   chan struct{}
+	shutdownLock sync.Mutex
+}
+
+func newNetPipeline(trans *NetworkTransport, conn *netConn) *netPipeline {
+	n := &netPipeline{
+		conn:         conn,
+		trans:        trans,
+		doneCh:       make(chan SyncFuture, rpcMaxPipeline),
+		inprogressCh: make(chan *syncFuture, rpcMaxPipeline),
+		shutdownCh:   make(chan struct{}),
+	}
+	go n.decodeResponses()
+	return n
+}
+
+// decodeResponses is a long running routine that decodes the responses
+// sent on the connection, in order.
+func (n *netPipeline) decodeResponses() {
+	timeout := n.trans.timeout
+	for {
+		select {
+		case future := <-n.inprogressCh:
+			if timeout > 0 {
+				n.conn.conn.SetReadDeadline(time.Now().Add(timeout))
+			}
+
+			_, err := decodeResponse(n.conn, future.resp, n.trans.logger)
+			future.respond(err)
+
+			select {
+			case n.doneCh <- future:
+			case <-n.shutdownCh:
+				return
+			}
+		case <-n.shutdownCh:
+			return
+		}
+	}
+}
+
+// Enqueue implements the SyncPipeline interface.
+func (n *netPipeline) Enqueue(args *SyncRequest, resp *SyncResponse) (SyncFuture, error) {
+	n.shutdownLock.Lock()
+	defer n.shutdownLock.Unlock()
+
+	future := &syncFuture{
+		start: time.Now(),
+		args:  args,
+		resp:  resp,
+	}
+	future.init()
+
+	if n.trans.timeout > 0 {
+		n.conn.conn.SetWriteDeadline(time.Now().Add(n.trans.timeout))
+	}
+
+	if err := sendRPC(n.conn, rpcSync, args, n.trans.logger); err != nil {
+		return nil, err
+	}
+
+	select {
+	case n.inprogressCh <- future:
+		return future, nil
+	case <-n.shutdownCh:
+		return nil, ErrPipelineShutdown
+	}
+}
+
+// Consumer implements the SyncPipeline interface.
+func (n *netPipeline) Consumer() <-chan SyncFuture {
+	return n.doneCh
+}
+
+// Close implements the SyncPipeline interface.
+func (n *netPipeline) Close() error {
+	n.shutdownLock.Lock()
+	defer n.shutdownLock.Unlock()
+	if n.shutdown {
+		return nil
+	}
+
+	close(n.shutdownCh)
+	n.shutdown = true
+	n.conn.Release()
+
+	// Fail any futures still queued for a response, so their Error does
+	// not block forever.
+	for {
+		select {
+		case future := <-n.inprogressCh:
+			future.respond(ErrPipelineShutdown)
+		default:
+			return nil
+		}
+	}
+}
+
+// SyncPipeline returns an interface that can be used to pipeline Sync
+// requests to the target. Callers doing back-to-back gossip syncs to the
+// same peer should prefer this over repeated calls to Sync, since it
+// keeps the connection full instead of paying one round trip per request.
+func (n *NetworkTransport) SyncPipeline(target string) (SyncPipeline, error) {
+	conn, err := n.getConn(target, n.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return newNetPipeline(n, conn), nil
+}
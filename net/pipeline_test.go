@@ -0,0 +1,129 @@
+/*
+Copyright 2017 Mosaic Networks Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package net
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestPipelineConn(conn net.Conn) *netConn {
+	nc := &netConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+	nc.dec = gob.NewDecoder(nc.r)
+	nc.enc = gob.NewEncoder(nc.w)
+	return nc
+}
+
+// TestNetPipelineFIFO drives several requests through a netPipeline ahead
+// of their responses, and checks each future is bound to its own request
+// despite responses being decoded off a single connection in arrival
+// order rather than by any correlation ID.
+func TestNetPipelineFIFO(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	trans := &NetworkTransport{timeout: time.Second, logger: testLogger()}
+	pipeline := newNetPipeline(trans, newTestPipelineConn(client))
+	defer pipeline.Close()
+
+	const n = 5
+	serverDoneCh := make(chan error, 1)
+	go func() {
+		r := bufio.NewReader(server)
+		w := bufio.NewWriter(server)
+		dec := gob.NewDecoder(r)
+		enc := gob.NewEncoder(w)
+
+		for i := 0; i < n; i++ {
+			rpcType, err := r.ReadByte()
+			if err != nil {
+				serverDoneCh <- err
+				return
+			}
+			if rpcType != rpcSync {
+				serverDoneCh <- fmt.Errorf("unexpected rpc type %d", rpcType)
+				return
+			}
+			var req SyncRequest
+			if err := dec.Decode(&req); err != nil {
+				serverDoneCh <- err
+				return
+			}
+			if err := enc.Encode(""); err != nil {
+				serverDoneCh <- err
+				return
+			}
+			if err := enc.Encode(&SyncResponse{FromID: req.FromID}); err != nil {
+				serverDoneCh <- err
+				return
+			}
+			if err := w.Flush(); err != nil {
+				serverDoneCh <- err
+				return
+			}
+		}
+		serverDoneCh <- nil
+	}()
+
+	futures := make([]SyncFuture, n)
+	for i := 0; i < n; i++ {
+		args := &SyncRequest{FromID: fmt.Sprintf("peer-%d", i)}
+		fut, err := pipeline.Enqueue(args, &SyncResponse{})
+		if err != nil {
+			t.Fatalf("Enqueue %d returned error: %v", i, err)
+		}
+		futures[i] = fut
+	}
+
+	for i, fut := range futures {
+		if err := fut.Error(); err != nil {
+			t.Fatalf("future %d returned error: %v", i, err)
+		}
+		want := fmt.Sprintf("peer-%d", i)
+		if got := fut.Response().FromID; got != want {
+			t.Errorf("future %d resolved to FromID %q, want %q (responses matched out of order)", i, got, want)
+		}
+	}
+
+	if err := <-serverDoneCh; err != nil {
+		t.Fatalf("fake server returned error: %v", err)
+	}
+}
+
+func TestNetPipelineEnqueueAfterCloseFails(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	trans := &NetworkTransport{timeout: time.Second, logger: testLogger()}
+	pipeline := newNetPipeline(trans, newTestPipelineConn(client))
+
+	if err := pipeline.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	if _, err := pipeline.Enqueue(&SyncRequest{FromID: "too-late"}, &SyncResponse{}); err == nil {
+		t.Fatal("Enqueue after Close returned nil error, want an error since the connection is gone")
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2017 Mosaic Networks Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package net
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// TCPStreamLayer is the default StreamLayer implementation, providing a
+// plain, unencrypted TCP stream abstraction.
+type TCPStreamLayer struct {
+	advertise net.Addr
+	listener  *net.TCPListener
+}
+
+// NewTCPStreamLayer creates a new TCPStreamLayer, listening on bindAddr.
+// advertise overrides the address reported by Addr() (e.g. when bindAddr
+// is not publicly routable); pass nil to advertise the listener's own
+// address.
+func NewTCPStreamLayer(bindAddr string, advertise net.Addr) (*TCPStreamLayer, error) {
+	listener, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &TCPStreamLayer{
+		advertise: advertise,
+		listener:  listener.(*net.TCPListener),
+	}, nil
+}
+
+// Dial implements the StreamLayer interface.
+func (t *TCPStreamLayer) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", address, timeout)
+}
+
+// Accept implements the net.Listener interface.
+func (t *TCPStreamLayer) Accept() (net.Conn, error) {
+	return t.listener.Accept()
+}
+
+// Close implements the net.Listener interface.
+func (t *TCPStreamLayer) Close() error {
+	return t.listener.Close()
+}
+
+// Addr implements the net.Listener interface.
+func (t *TCPStreamLayer) Addr() net.Addr {
+	if t.advertise != nil {
+		return t.advertise
+	}
+	return t.listener.Addr()
+}
+
+// TLSStreamLayer is a StreamLayer implementation that wraps every
+// connection, incoming and outgoing, in TLS. Construct one from a
+// *tls.Config built however the caller prefers (NewTLSStreamLayerFromFiles
+// is a convenience for the common cert/key/CA-file case).
+//
+// VerifyPeer, when set, is called against the negotiated
+// tls.ConnectionState of every connection, both accepted and dialed. It
+// lets babble nodes pin the remote's certificate to the participant's
+// public key from the peer set, rather than trusting TLS's own CA-based
+// verification alone.
+type TLSStreamLayer struct {
+	advertise  net.Addr
+	listener   net.Listener
+	tlsConfig  *tls.Config
+	verifyPeer func(state tls.ConnectionState) error
+}
+
+// NewTLSStreamLayer creates a new TLSStreamLayer, listening on bindAddr
+// with the given tls.Config. advertise overrides the address reported by
+// Addr(); pass nil to advertise the listener's own address.
+func NewTLSStreamLayer(
+	bindAddr string,
+	advertise net.Addr,
+	tlsConfig *tls.Config,
+	verifyPeer func(state tls.ConnectionState) error,
+) (*TLSStreamLayer, error) {
+	listener, err := tls.Listen("tcp", bindAddr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &TLSStreamLayer{
+		advertise:  advertise,
+		listener:   listener,
+		tlsConfig:  tlsConfig,
+		verifyPeer: verifyPeer,
+	}, nil
+}
+
+// NewTLSStreamLayerFromFiles is a convenience constructor that builds a
+// *tls.Config requiring and verifying client certificates against caFile,
+// then delegates to NewTLSStreamLayer.
+func NewTLSStreamLayerFromFiles(
+	bindAddr string,
+	advertise net.Addr,
+	certFile, keyFile, caFile string,
+	verifyPeer func(state tls.ConnectionState) error,
+) (*TLSStreamLayer, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		RootCAs:      caPool,
+	}
+
+	return NewTLSStreamLayer(bindAddr, advertise, tlsConfig, verifyPeer)
+}
+
+// Dial implements the StreamLayer interface.
+func (t *TLSStreamLayer) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, t.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.verifyPeer != nil {
+		if err := t.verifyPeer(conn.ConnectionState()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// Accept implements the net.Listener interface.
+func (t *TLSStreamLayer) Accept() (net.Conn, error) {
+	conn, err := t.listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("expected *tls.Conn from tls.Listen, got %T", conn)
+	}
+
+	if t.verifyPeer != nil {
+		if err := tlsConn.Handshake(); err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+		if err := t.verifyPeer(tlsConn.ConnectionState()); err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+	}
+
+	return tlsConn, nil
+}
+
+// Close implements the net.Listener interface.
+func (t *TLSStreamLayer) Close() error {
+	return t.listener.Close()
+}
+
+// Addr implements the net.Listener interface.
+func (t *TLSStreamLayer) Addr() net.Addr {
+	if t.advertise != nil {
+		return t.advertise
+	}
+	return t.listener.Addr()
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2017 Mosaic Networks Ltd
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package net
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// genSelfSignedCert builds a self-signed certificate/key pair for
+// commonName, suitable for use as its own CA: tests pin it directly in
+// RootCAs/ClientCAs rather than standing up a real CA hierarchy.
+func genSelfSignedCert(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+}
+
+// mutualTLSConfigs returns a (server, client) tls.Config pair configured
+// for mutual auth off a single self-signed cert, which acts as its own
+// trusted CA on both sides.
+func mutualTLSConfigs(t *testing.T, cert tls.Certificate) (server, client *tls.Config) {
+	t.Helper()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	server = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	client = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   "127.0.0.1",
+	}
+	return server, client
+}
+
+func TestTLSStreamLayerRoundTrip(t *testing.T) {
+	cert := genSelfSignedCert(t, "127.0.0.1")
+	serverConfig, clientConfig := mutualTLSConfigs(t, cert)
+
+	var verifiedServerSide, verifiedClientSide int32
+	verify := func(name *int32) func(tls.ConnectionState) error {
+		return func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("no peer certificate presented")
+			}
+			if state.PeerCertificates[0].Subject.CommonName != "127.0.0.1" {
+				return errors.New("unexpected peer certificate")
+			}
+			*name++
+			return nil
+		}
+	}
+
+	layer, err := NewTLSStreamLayer("127.0.0.1:0", nil, serverConfig, verify(&verifiedServerSide))
+	if err != nil {
+		t.Fatalf("failed to start TLSStreamLayer: %v", err)
+	}
+	defer layer.Close()
+
+	acceptedCh := make(chan net.Conn, 1)
+	acceptErrCh := make(chan error, 1)
+	go func() {
+		conn, err := layer.Accept()
+		if err != nil {
+			acceptErrCh <- err
+			return
+		}
+		acceptedCh <- conn
+	}()
+
+	clientLayer := &TLSStreamLayer{tlsConfig: clientConfig, verifyPeer: verify(&verifiedClientSide)}
+	conn, err := clientLayer.Dial(layer.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var serverConn net.Conn
+	select {
+	case serverConn = <-acceptedCh:
+	case err := <-acceptErrCh:
+		t.Fatalf("Accept failed: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for Accept")
+	}
+	defer serverConn.Close()
+
+	const msg = "babble over TLS"
+	go func() {
+		conn.Write([]byte(msg))
+	}()
+
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(serverConn, buf); err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	if !bytes.Equal(buf, []byte(msg)) {
+		t.Fatalf("got %q, want %q", buf, msg)
+	}
+
+	if verifiedServerSide != 1 {
+		t.Errorf("server-side verifyPeer ran %d times, want 1", verifiedServerSide)
+	}
+	if verifiedClientSide != 1 {
+		t.Errorf("client-side verifyPeer ran %d times, want 1", verifiedClientSide)
+	}
+}
+
+func TestTLSStreamLayerVerifyPeerRejectsAccept(t *testing.T) {
+	cert := genSelfSignedCert(t, "127.0.0.1")
+	serverConfig, clientConfig := mutualTLSConfigs(t, cert)
+
+	rejectAll := func(tls.ConnectionState) error {
+		return errors.New("peer not in participant set")
+	}
+
+	layer, err := NewTLSStreamLayer("127.0.0.1:0", nil, serverConfig, rejectAll)
+	if err != nil {
+		t.Fatalf("failed to start TLSStreamLayer: %v", err)
+	}
+	defer layer.Close()
+
+	acceptErrCh := make(chan error, 1)
+	go func() {
+		_, err := layer.Accept()
+		acceptErrCh <- err
+	}()
+
+	clientLayer := &TLSStreamLayer{tlsConfig: clientConfig}
+	conn, err := clientLayer.Dial(layer.Addr().String(), time.Second)
+	if err == nil {
+		conn.Close()
+	}
+
+	select {
+	case err := <-acceptErrCh:
+		if err == nil {
+			t.Fatal("Accept returned nil error, want the rejection from verifyPeer")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for Accept to reject the connection")
+	}
+}